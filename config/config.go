@@ -0,0 +1,75 @@
+/*
+Copyright 2016 Skippbox, Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import "time"
+
+// DefaultResyncPeriod is how often an informer resyncs its store when a
+// resource has no entry in Config.ResyncPeriods.
+const DefaultResyncPeriod = 30 * time.Minute
+
+// Config lists the resources kubewatch should watch, and how it should
+// scope and schedule those watches.
+type Config struct {
+	Resource Resource `json:"resource"`
+
+	// Namespace restricts watches to a single namespace. Leave empty to
+	// watch across all namespaces (api.NamespaceAll).
+	Namespace string `json:"namespace"`
+
+	// LabelSelector and FieldSelector further narrow the set of objects
+	// watched for every enabled resource, e.g. "tier=frontend" or
+	// "status.phase=Running". Leave empty to match everything.
+	LabelSelector string `json:"labelSelector"`
+	FieldSelector string `json:"fieldSelector"`
+
+	// CustomResources lists CustomResourceDefinitions to watch in addition
+	// to the built-in resources above, e.g. Karmada's PropagationPolicy.
+	CustomResources []CustomResource `json:"customResources"`
+
+	// ResyncPeriods overrides DefaultResyncPeriod per resource, built-in or
+	// custom, keyed by its REST resource name (e.g. "pods", "persistentvolumes"),
+	// so a chatty resource can resync more often than a stable one.
+	ResyncPeriods map[string]time.Duration `json:"resyncPeriods"`
+}
+
+// ResyncPeriod returns the configured resync period for resource, falling
+// back to DefaultResyncPeriod when it has no override.
+func (c *Config) ResyncPeriod(resource string) time.Duration {
+	if d, ok := c.ResyncPeriods[resource]; ok {
+		return d
+	}
+	return DefaultResyncPeriod
+}
+
+// CustomResource identifies a CustomResourceDefinition kubewatch should
+// watch via the dynamic client.
+type CustomResource struct {
+	Group    string `json:"group"`
+	Version  string `json:"version"`
+	Resource string `json:"resource"`
+}
+
+// Resource toggles which built-in Kubernetes resources kubewatch watches.
+type Resource struct {
+	Deployment            bool `json:"deployment"`
+	ReplicationController bool `json:"rc"`
+	Services              bool `json:"services"`
+	Pod                   bool `json:"pod"`
+	Job                   bool `json:"job"`
+	PersistentVolume      bool `json:"pv"`
+}
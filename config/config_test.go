@@ -0,0 +1,38 @@
+/*
+Copyright 2016 Skippbox, Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConfigResyncPeriod(t *testing.T) {
+	c := &Config{
+		ResyncPeriods: map[string]time.Duration{
+			"pods": 5 * time.Minute,
+		},
+	}
+
+	if got := c.ResyncPeriod("pods"); got != 5*time.Minute {
+		t.Errorf("ResyncPeriod(%q) = %v, want %v", "pods", got, 5*time.Minute)
+	}
+
+	if got := c.ResyncPeriod("services"); got != DefaultResyncPeriod {
+		t.Errorf("ResyncPeriod(%q) with no override = %v, want %v", "services", got, DefaultResyncPeriod)
+	}
+}
@@ -18,22 +18,87 @@ package controller
 
 import (
 	"net/http"
-	"time"
+	"reflect"
+	"sync"
 
 	"github.com/Sirupsen/logrus"
 	"github.com/skippbox/kubewatch/config"
 	"github.com/skippbox/kubewatch/pkg/handlers"
 	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
 	"k8s.io/client-go/kubernetes"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
 	"k8s.io/client-go/pkg/api"
 	batchv1 "k8s.io/client-go/pkg/apis/batch/v1"
 	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/tools/clientcmd"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
 )
 
+// workers is the number of goroutines draining each resource's event queue.
+const workers = 2
+
+// resourceDef describes one built-in resource kubewatch can watch. Adding a
+// new built-in kind (e.g. Ingress, ConfigMap, Namespace) is a single entry
+// in builtinResources, instead of a new near-duplicate watch* function.
+type resourceDef struct {
+	// name is both the REST resource name (e.g. "pods") and the
+	// Config.ResyncPeriods lookup key.
+	name          string
+	enabled       func(r config.Resource) bool
+	exampleObject runtime.Object
+	client        func(*kubernetes.Clientset) cache.Getter
+	// clusterScoped is true for resources with no namespace, such as
+	// PersistentVolume. getListWatch never applies conf.Namespace to these.
+	clusterScoped bool
+}
+
+var builtinResources = []resourceDef{
+	{
+		name:          "pods",
+		enabled:       func(r config.Resource) bool { return r.Pod },
+		exampleObject: &api.Pod{},
+		client:        func(cs *kubernetes.Clientset) cache.Getter { return cs.Core().RESTClient() },
+	},
+	{
+		name:          "services",
+		enabled:       func(r config.Resource) bool { return r.Services },
+		exampleObject: &api.Service{},
+		client:        func(cs *kubernetes.Clientset) cache.Getter { return cs.Core().RESTClient() },
+	},
+	{
+		name:          "replicationcontrollers",
+		enabled:       func(r config.Resource) bool { return r.ReplicationController },
+		exampleObject: &api.ReplicationController{},
+		client:        func(cs *kubernetes.Clientset) cache.Getter { return cs.Core().RESTClient() },
+	},
+	{
+		name:          "deployments",
+		enabled:       func(r config.Resource) bool { return r.Deployment },
+		exampleObject: &v1beta1.Deployment{},
+		client:        func(cs *kubernetes.Clientset) cache.Getter { return cs.ExtensionsV1beta1().RESTClient() },
+	},
+	{
+		name:          "jobs",
+		enabled:       func(r config.Resource) bool { return r.Job },
+		exampleObject: &batchv1.Job{},
+		client:        func(cs *kubernetes.Clientset) cache.Getter { return cs.BatchV1().RESTClient() },
+	},
+	{
+		name:          "persistentvolumes",
+		enabled:       func(r config.Resource) bool { return r.PersistentVolume },
+		exampleObject: &api.PersistentVolume{},
+		client:        func(cs *kubernetes.Clientset) cache.Getter { return cs.Core().RESTClient() },
+		clusterScoped: true,
+	},
+}
+
 func Controller(conf *config.Config, eventHandler handlers.Handler) {
 
 	rawConfig, err := clientcmd.NewDefaultClientConfigLoadingRules().Load()
@@ -48,169 +113,142 @@ func Controller(conf *config.Config, eventHandler handlers.Handler) {
 
 	kubeClient := kubernetes.NewForConfigOrDie(restConfig)
 
-	if conf.Resource.Pod {
-		watchPods(kubeClient, eventHandler)
-	}
-
-	if conf.Resource.Services {
-		watchServices(kubeClient, eventHandler)
-	}
-
-	if conf.Resource.ReplicationController {
-		watchReplicationControllers(kubeClient, eventHandler)
-	}
+	eventBroadcaster := record.NewBroadcaster()
+	eventBroadcaster.StartLogging(logrus.Infof)
+	eventBroadcaster.StartRecordingToSink(&corev1.EventSinkImpl{Interface: kubeClient.Core().Events("")})
+	recorder := eventBroadcaster.NewRecorder(api.Scheme, api.EventSource{Component: "kubewatch"})
 
-	if conf.Resource.Deployment {
-		watchDeployments(kubeClient, eventHandler)
-	}
+	eventHandler.SetEventRecorder(recorder)
 
-	if conf.Resource.Job {
-		watchJobs(kubeClient, eventHandler)
+	for _, rd := range builtinResources {
+		if rd.enabled(conf.Resource) {
+			watchResource(kubeClient, conf, rd, eventHandler, recorder)
+		}
 	}
 
-	if conf.Resource.PersistentVolume {
-		var servicesStore cache.Store
-		servicesStore = watchPersistenVolumes(kubeClient, servicesStore, eventHandler)
+	for _, cr := range conf.CustomResources {
+		watchCustomResource(restConfig, conf, cr, eventHandler, recorder)
 	}
 
 	logrus.Fatal(http.ListenAndServe(":8081", nil))
 }
 
-func watchPods(clientset *kubernetes.Clientset, eventHandler handlers.Handler) cache.Store {
-	//Define what we want to look for (Pods)
-	watchlist := cache.NewListWatchFromClient(clientset.Core().RESTClient(), "pods", api.NamespaceAll, fields.Everything())
-
-	resyncPeriod := 30 * time.Minute
-
-	//Setup an informer to call functions when the watchlist changes
-	eStore, eController := cache.NewInformer(
-		watchlist,
-		&api.Pod{},
-		resyncPeriod,
-		cache.ResourceEventHandlerFuncs{
-			AddFunc:    eventHandler.ObjectCreated,
-			DeleteFunc: eventHandler.ObjectDeleted,
-		},
-	)
-
-	//Run the controller as a goroutine
-	go eController.Run(wait.NeverStop)
-
-	return eStore
-}
+// getListWatch builds a cache.ListWatch for resource that scopes every
+// List/Watch call to conf.Namespace (api.NamespaceAll if unset) and injects
+// conf.LabelSelector/conf.FieldSelector, instead of the blanket
+// cache.NewListWatchFromClient(client, resource, api.NamespaceAll, fields.Everything()).
+// clusterScoped resources (e.g. PersistentVolume) never get conf.Namespace
+// applied, since they have no namespace to scope to.
+func getListWatch(client cache.Getter, resource string, conf *config.Config, clusterScoped bool) *cache.ListWatch {
+	labelSelector, err := labels.Parse(conf.LabelSelector)
+	if err != nil {
+		logrus.Fatal(err)
+	}
 
-func watchServices(clientset *kubernetes.Clientset, eventHandler handlers.Handler) cache.Store {
-	//Define what we want to look for (Services)
-	watchlist := cache.NewListWatchFromClient(clientset.Core().RESTClient(), "services", api.NamespaceAll, fields.Everything())
+	fieldSelector, err := fields.ParseSelector(conf.FieldSelector)
+	if err != nil {
+		logrus.Fatal(err)
+	}
 
-	resyncPeriod := 30 * time.Minute
+	namespace := conf.Namespace
+	if namespace == "" || clusterScoped {
+		namespace = api.NamespaceAll
+	}
 
-	//Setup an informer to call functions when the watchlist changes
-	eStore, eController := cache.NewInformer(
-		watchlist,
-		&api.Service{},
-		resyncPeriod,
-		cache.ResourceEventHandlerFuncs{
-			AddFunc:    eventHandler.ObjectCreated,
-			DeleteFunc: eventHandler.ObjectDeleted,
-			UpdateFunc: eventHandler.ObjectUpdated,
+	return &cache.ListWatch{
+		ListFunc: func(options api.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = labelSelector
+			options.FieldSelector = fieldSelector
+			return client.Get().
+				Namespace(namespace).
+				Resource(resource).
+				VersionedParams(&options, api.ParameterCodec).
+				Do().
+				Get()
 		},
-	)
-
-	//Run the controller as a goroutine
-	go eController.Run(wait.NeverStop)
-
-	return eStore
-}
-
-func watchReplicationControllers(clientset *kubernetes.Clientset, eventHandler handlers.Handler) cache.Store {
-	//Define what we want to look for (ReplicationControllers)
-	watchlist := cache.NewListWatchFromClient(clientset.Core().RESTClient(), "replicationcontrollers", api.NamespaceAll, fields.Everything())
-
-	resyncPeriod := 30 * time.Minute
-
-	//Setup an informer to call functions when the watchlist changes
-	eStore, eController := cache.NewInformer(
-		watchlist,
-		&api.ReplicationController{},
-		resyncPeriod,
-		cache.ResourceEventHandlerFuncs{
-			AddFunc:    eventHandler.ObjectCreated,
-			DeleteFunc: eventHandler.ObjectDeleted,
+		WatchFunc: func(options api.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = labelSelector
+			options.FieldSelector = fieldSelector
+			options.Watch = true
+			return client.Get().
+				Prefix("watch").
+				Namespace(namespace).
+				Resource(resource).
+				VersionedParams(&options, api.ParameterCodec).
+				Watch()
 		},
-	)
-
-	//Run the controller as a goroutine
-	go eController.Run(wait.NeverStop)
-
-	return eStore
+	}
 }
 
-func watchDeployments(clientset *kubernetes.Clientset, eventHandler handlers.Handler) cache.Store {
-	//Define what we want to look for (Deployments)
-	watchlist := cache.NewListWatchFromClient(clientset.ExtensionsV1beta1().RESTClient(), "deployments", api.NamespaceAll, fields.Everything())
-
-	resyncPeriod := 30 * time.Minute
-
-	//Setup an informer to call functions when the watchlist changes
-	eStore, eController := cache.NewInformer(
-		watchlist,
-		&v1beta1.Deployment{},
-		resyncPeriod,
-		cache.ResourceEventHandlerFuncs{
-			AddFunc:    eventHandler.ObjectCreated,
-			DeleteFunc: eventHandler.ObjectDeleted,
+// newEventHandlerFuncs builds the cache.ResourceEventHandlerFuncs shared by
+// every watched resource: instead of calling eventHandler directly from the
+// informer goroutine, it enqueues just the object's key onto queue, so a
+// slow or failing notifier backend can never block the informer, every event
+// for a given key coalesces into one pending item, and a worker can resolve
+// the key back to the current object via the informer's own cache.Store
+// (eventProcessor tells create/update/delete apart itself). DeleteFunc
+// stashes the object in tombstones first, since by the time a worker gets to
+// the delete event cache.Store no longer has it.
+func newEventHandlerFuncs(queue workqueue.RateLimitingInterface, tombstones *sync.Map) cache.ResourceEventHandlerFuncs {
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			key, err := cache.MetaNamespaceKeyFunc(obj)
+			if err != nil {
+				logrus.Errorf("couldn't get key for added object: %v", err)
+				return
+			}
+			queue.Add(queuedEvent{key: key})
 		},
-	)
-
-	//Run the controller as a goroutine
-	go eController.Run(wait.NeverStop)
-
-	return eStore
-}
-
-func watchJobs(clientset *kubernetes.Clientset, eventHandler handlers.Handler) cache.Store {
-	//Define what we want to look for (Jobs)
-	watchlist := cache.NewListWatchFromClient(clientset.BatchV1().RESTClient(), "jobs", api.NamespaceAll, fields.Everything())
-
-	resyncPeriod := 30 * time.Minute
-
-	//Setup an informer to call functions when the watchlist changes
-	eStore, eController := cache.NewInformer(
-		watchlist,
-		&batchv1.Job{},
-		resyncPeriod,
-		cache.ResourceEventHandlerFuncs{
-			AddFunc:    eventHandler.ObjectCreated,
-			DeleteFunc: eventHandler.ObjectDeleted,
+		DeleteFunc: func(obj interface{}) {
+			key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+			if err != nil {
+				logrus.Errorf("couldn't get key for deleted object: %v", err)
+				return
+			}
+			tombstones.Store(key, obj)
+			queue.Add(queuedEvent{key: key})
 		},
-	)
-
-	//Run the controller as a goroutine
-	go eController.Run(wait.NeverStop)
+		UpdateFunc: newUpdateFunc(queue),
+	}
+}
 
-	return eStore
+// newUpdateFunc returns an UpdateFunc that enqueues cur's key for
+// handlers.Handler.ObjectUpdated, skipping the resync's identity updates
+// (old and cur equal) so they don't reach notifier backends as no-op
+// "something updated" noise.
+func newUpdateFunc(queue workqueue.RateLimitingInterface) func(old, cur interface{}) {
+	return func(old, cur interface{}) {
+		if reflect.DeepEqual(old, cur) {
+			return
+		}
+
+		key, err := cache.MetaNamespaceKeyFunc(cur)
+		if err != nil {
+			logrus.Errorf("couldn't get key for updated object: %v", err)
+			return
+		}
+		queue.Add(queuedEvent{key: key})
+	}
 }
 
-func watchPersistenVolumes(clientset *kubernetes.Clientset, store cache.Store, eventHandler handlers.Handler) cache.Store {
-	//Define what we want to look for (PersistenVolumes)
-	watchlist := cache.NewListWatchFromClient(clientset.Core().RESTClient(), "persistentvolumes", api.NamespaceAll, fields.Everything())
+// watchResource sets up an informer for rd: a scoped ListWatch feeding a
+// rate-limited workqueue, drained by a pool of workers that dispatch to
+// eventHandler and record Events through recorder.
+func watchResource(clientset *kubernetes.Clientset, conf *config.Config, rd resourceDef, eventHandler handlers.Handler, recorder record.EventRecorder) cache.Store {
+	watchlist := getListWatch(rd.client(clientset), rd.name, conf, rd.clusterScoped)
 
-	resyncPeriod := 30 * time.Minute
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	tombstones := &sync.Map{}
 
-	//Setup an informer to call functions when the watchlist changes
 	eStore, eController := cache.NewInformer(
 		watchlist,
-		&api.PersistentVolume{},
-		resyncPeriod,
-		cache.ResourceEventHandlerFuncs{
-			AddFunc:    eventHandler.ObjectCreated,
-			DeleteFunc: eventHandler.ObjectDeleted,
-		},
+		rd.exampleObject,
+		conf.ResyncPeriod(rd.name),
+		newEventHandlerFuncs(queue, tombstones),
 	)
 
-	//Run the controller as a goroutine
 	go eController.Run(wait.NeverStop)
+	go runWorkers(queue, eStore, tombstones, eventHandler, recorder, workers, wait.NeverStop)
 
 	return eStore
 }
@@ -0,0 +1,121 @@
+/*
+Copyright 2016 Skippbox, Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/skippbox/kubewatch/config"
+	"github.com/skippbox/kubewatch/pkg/handlers"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// watchCustomResource watches an arbitrary CustomResourceDefinition, so
+// operators aren't limited to the six resource kinds kubewatch knows
+// about natively. Whether cr is namespaced isn't hardcoded by callers: it is
+// looked up from the cluster's discovery document. conf.Namespace/LabelSelector/
+// FieldSelector scope the watch the same way they do for every built-in
+// resource's getListWatch.
+func watchCustomResource(restConfig *rest.Config, conf *config.Config, cr config.CustomResource, eventHandler handlers.Handler, recorder record.EventRecorder) cache.Store {
+	gvr := schema.GroupVersionResource{Group: cr.Group, Version: cr.Version, Resource: cr.Resource}
+
+	discoveryClient, err := discovery.NewDiscoveryClientForConfig(restConfig)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	namespaced, err := isNamespaced(discoveryClient, gvr)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		logrus.Fatal(err)
+	}
+
+	resourceClient := dynamicClient.Resource(gvr)
+
+	namespace := conf.Namespace
+	if namespace == "" {
+		namespace = metav1.NamespaceAll
+	}
+
+	watchlist := &cache.ListWatch{
+		ListFunc: func(options metav1.ListOptions) (runtime.Object, error) {
+			options.LabelSelector = conf.LabelSelector
+			options.FieldSelector = conf.FieldSelector
+			if namespaced {
+				return resourceClient.Namespace(namespace).List(options)
+			}
+			return resourceClient.List(options)
+		},
+		WatchFunc: func(options metav1.ListOptions) (watch.Interface, error) {
+			options.LabelSelector = conf.LabelSelector
+			options.FieldSelector = conf.FieldSelector
+			if namespaced {
+				return resourceClient.Namespace(namespace).Watch(options)
+			}
+			return resourceClient.Watch(options)
+		},
+	}
+
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	tombstones := &sync.Map{}
+
+	eStore, eController := cache.NewInformer(
+		watchlist,
+		&unstructured.Unstructured{},
+		conf.ResyncPeriod(cr.Resource),
+		newEventHandlerFuncs(queue, tombstones),
+	)
+
+	go eController.Run(wait.NeverStop)
+	go runWorkers(queue, eStore, tombstones, eventHandler, recorder, workers, wait.NeverStop)
+
+	return eStore
+}
+
+// isNamespaced reports whether gvr is a namespaced resource, consulting the
+// cluster's discovery document instead of assuming a REST path.
+func isNamespaced(discoveryClient discovery.DiscoveryInterface, gvr schema.GroupVersionResource) (bool, error) {
+	resourceList, err := discoveryClient.ServerResourcesForGroupVersion(gvr.GroupVersion().String())
+	if err != nil {
+		return false, err
+	}
+
+	for _, apiResource := range resourceList.APIResources {
+		if apiResource.Name == gvr.Resource {
+			return apiResource.Namespaced, nil
+		}
+	}
+
+	return false, fmt.Errorf("resource %q not found in %s", gvr.Resource, gvr.GroupVersion())
+}
@@ -0,0 +1,84 @@
+/*
+Copyright 2016 Skippbox, Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+)
+
+// fakeDiscoveryClient stubs just the method isNamespaced calls; every other
+// discovery.DiscoveryInterface method panics if exercised.
+type fakeDiscoveryClient struct {
+	discovery.DiscoveryInterface
+	resourceList *metav1.APIResourceList
+}
+
+func (f *fakeDiscoveryClient) ServerResourcesForGroupVersion(groupVersion string) (*metav1.APIResourceList, error) {
+	return f.resourceList, nil
+}
+
+func TestIsNamespaced(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "example.io", Version: "v1", Resource: "widgets"}
+	client := &fakeDiscoveryClient{
+		resourceList: &metav1.APIResourceList{
+			APIResources: []metav1.APIResource{
+				{Name: "widgets", Namespaced: true},
+				{Name: "clusterwidgets", Namespaced: false},
+			},
+		},
+	}
+
+	namespaced, err := isNamespaced(client, gvr)
+	if err != nil {
+		t.Fatalf("isNamespaced() error = %v", err)
+	}
+	if !namespaced {
+		t.Errorf("isNamespaced() = false, want true")
+	}
+}
+
+func TestIsNamespacedClusterScoped(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "example.io", Version: "v1", Resource: "clusterwidgets"}
+	client := &fakeDiscoveryClient{
+		resourceList: &metav1.APIResourceList{
+			APIResources: []metav1.APIResource{
+				{Name: "clusterwidgets", Namespaced: false},
+			},
+		},
+	}
+
+	namespaced, err := isNamespaced(client, gvr)
+	if err != nil {
+		t.Fatalf("isNamespaced() error = %v", err)
+	}
+	if namespaced {
+		t.Errorf("isNamespaced() = true, want false")
+	}
+}
+
+func TestIsNamespacedNotFound(t *testing.T) {
+	gvr := schema.GroupVersionResource{Group: "example.io", Version: "v1", Resource: "missing"}
+	client := &fakeDiscoveryClient{resourceList: &metav1.APIResourceList{}}
+
+	if _, err := isNamespaced(client, gvr); err == nil {
+		t.Error("isNamespaced() error = nil, want an error for an unknown resource")
+	}
+}
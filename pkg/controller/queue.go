@@ -0,0 +1,194 @@
+/*
+Copyright 2016 Skippbox, Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Sirupsen/logrus"
+	"github.com/skippbox/kubewatch/pkg/handlers"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/pkg/api"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// maxRetries is the number of times a queued event is retried before it is
+// dropped as a poison pill.
+const maxRetries = 5
+
+// queuedEvent is what informer callbacks enqueue. It carries only the
+// cache.MetaNamespaceKeyFunc key, nothing else, so every event for the same
+// key - an add, any number of updates, or a delete - compares equal and
+// workqueue's item-equality dedup/serialization actually holds across all of
+// them: at most one pending item per key, and never two workers processing
+// the same key at once. A worker resolves key back to the current object via
+// the informer's cache.Store, and tells create/update/delete apart using
+// eventProcessor's tombstones and lastNotified side maps.
+type queuedEvent struct {
+	key string
+}
+
+// eventProcessor drains a resource's workqueue and dispatches each event to
+// eventHandler. tombstones holds the last object seen for a key that
+// DeleteFunc has fired for but no dispatch has consumed yet, since by the
+// time a delete reaches a worker cache.Store no longer has the object.
+// lastNotified remembers the last object successfully notified about for
+// each key, so a dispatch can tell an add from an update (a key not yet in
+// lastNotified is a create) and hand ObjectUpdated a real "old" value.
+type eventProcessor struct {
+	store        cache.Store
+	tombstones   *sync.Map // key -> interface{}, populated by DeleteFunc
+	eventHandler handlers.Handler
+	recorder     record.EventRecorder
+	lastNotified sync.Map // key -> interface{}
+}
+
+// runWorkers starts threadiness worker goroutines that drain queue and
+// dispatch each event to eventHandler until stopCh is closed. recorder
+// records a Warning Event against the offending object when an event is
+// dropped as a poison pill, so delivery failures show up on
+// `kubectl describe` for that object.
+func runWorkers(queue workqueue.RateLimitingInterface, store cache.Store, tombstones *sync.Map, eventHandler handlers.Handler, recorder record.EventRecorder, threadiness int, stopCh <-chan struct{}) {
+	p := &eventProcessor{store: store, tombstones: tombstones, eventHandler: eventHandler, recorder: recorder}
+
+	for i := 0; i < threadiness; i++ {
+		go wait.Until(func() {
+			for p.processNextItem(queue) {
+			}
+		}, time.Second, stopCh)
+	}
+}
+
+// processNextItem dequeues a single event, dispatches it and tells queue
+// whether to forget it or retry it with backoff. It returns false once the
+// queue is shutting down.
+func (p *eventProcessor) processNextItem(queue workqueue.RateLimitingInterface) bool {
+	item, quit := queue.Get()
+	if quit {
+		return false
+	}
+	defer queue.Done(item)
+
+	err := p.dispatch(item.(queuedEvent))
+	p.handleErr(queue, item, err)
+	return true
+}
+
+func (p *eventProcessor) dispatch(event queuedEvent) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic handling event for %s: %v", event.key, r)
+		}
+	}()
+
+	if deletedObj, ok := p.tombstones.LoadAndDelete(event.key); ok {
+		err = p.eventHandler.ObjectDeleted(deletedObj)
+		if err != nil {
+			// Put it back so a retry of this same item can still find it.
+			p.tombstones.Store(event.key, deletedObj)
+			return err
+		}
+		p.lastNotified.Delete(event.key)
+		p.recordSuccess("delete", deletedObj)
+		return nil
+	}
+
+	obj, exists, err := p.store.GetByKey(event.key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		// Already gone again by the time we got to it; the tombstone branch
+		// above will notify instead once the delete event is processed.
+		return nil
+	}
+
+	old, hadOld := p.lastNotified.Load(event.key)
+	if hadOld {
+		logrus.Infof("%s: %s", event.key, handlers.Diff(old, obj))
+		err = p.eventHandler.ObjectUpdated(old, obj)
+	} else {
+		err = p.eventHandler.ObjectCreated(obj)
+	}
+	if err == nil {
+		p.lastNotified.Store(event.key, obj)
+		if hadOld {
+			p.recordSuccess("update", obj)
+		} else {
+			p.recordSuccess("add", obj)
+		}
+	}
+	return err
+}
+
+// recordSuccess records a Normal "Notified" Event against obj after
+// eventHandler has successfully forwarded an action event, so a successful
+// delivery is observable via `kubectl describe` the same way a dropped one
+// is.
+func (p *eventProcessor) recordSuccess(action string, obj interface{}) {
+	if p.recorder == nil {
+		return
+	}
+
+	if ro, ok := obj.(runtime.Object); ok {
+		p.recorder.Eventf(ro, api.EventTypeNormal, "Notified", "dispatched %s event to notifier", action)
+	}
+}
+
+func (p *eventProcessor) handleErr(queue workqueue.RateLimitingInterface, item interface{}, err error) {
+	if err == nil {
+		queue.Forget(item)
+		return
+	}
+
+	event := item.(queuedEvent)
+	if queue.NumRequeues(item) < maxRetries {
+		logrus.Errorf("error dispatching event for %s (will retry): %v", event.key, err)
+		queue.AddRateLimited(item)
+		return
+	}
+
+	logrus.Errorf("dropping event for %s after %d retries: %v", event.key, maxRetries, err)
+	p.recordFailure(event, err)
+	// Nothing will ever dispatch this key's tombstone again, so drop it
+	// instead of leaking it for the rest of the process's life.
+	p.tombstones.Delete(event.key)
+	queue.Forget(item)
+}
+
+// recordFailure records a Warning Event against the object an event was
+// about, resolving it from the delete tombstone or the resource's
+// cache.Store as appropriate.
+func (p *eventProcessor) recordFailure(event queuedEvent, err error) {
+	if p.recorder == nil {
+		return
+	}
+
+	obj, ok := p.tombstones.Load(event.key)
+	if !ok {
+		obj, _, _ = p.store.GetByKey(event.key)
+	}
+
+	if ro, ok := obj.(runtime.Object); ok {
+		p.recorder.Eventf(ro, api.EventTypeWarning, "NotifyFailed", "failed to dispatch event after %d retries: %v", maxRetries, err)
+	}
+}
@@ -0,0 +1,172 @@
+/*
+Copyright 2016 Skippbox, Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"k8s.io/client-go/pkg/api"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// fakeHandler records every call it receives and returns the configured
+// error for each method, so tests can drive eventProcessor.dispatch's
+// create/update/delete branches and its error propagation.
+type fakeHandler struct {
+	createErr, deleteErr, updateErr error
+
+	created []interface{}
+	deleted []interface{}
+	updated [][2]interface{}
+}
+
+func (f *fakeHandler) SetEventRecorder(recorder record.EventRecorder) {}
+
+func (f *fakeHandler) ObjectCreated(obj interface{}) error {
+	f.created = append(f.created, obj)
+	return f.createErr
+}
+
+func (f *fakeHandler) ObjectDeleted(obj interface{}) error {
+	f.deleted = append(f.deleted, obj)
+	return f.deleteErr
+}
+
+func (f *fakeHandler) ObjectUpdated(old, cur interface{}) error {
+	f.updated = append(f.updated, [2]interface{}{old, cur})
+	return f.updateErr
+}
+
+func TestDispatchCreateThenUpdate(t *testing.T) {
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	pod := &api.Pod{
+		ObjectMeta: api.ObjectMeta{Name: "foo", Namespace: "default"},
+		Status:     api.PodStatus{Phase: api.PodPending},
+	}
+	store.Add(pod)
+	key, err := cache.MetaNamespaceKeyFunc(pod)
+	if err != nil {
+		t.Fatalf("MetaNamespaceKeyFunc() error = %v", err)
+	}
+
+	h := &fakeHandler{}
+	p := &eventProcessor{store: store, tombstones: &sync.Map{}, eventHandler: h}
+
+	if err := p.dispatch(queuedEvent{key: key}); err != nil {
+		t.Fatalf("dispatch() error = %v", err)
+	}
+	if len(h.created) != 1 || len(h.updated) != 0 {
+		t.Fatalf("after first dispatch: created=%d updated=%d, want 1 and 0", len(h.created), len(h.updated))
+	}
+
+	updatedPod := &api.Pod{ObjectMeta: pod.ObjectMeta, Status: api.PodStatus{Phase: api.PodRunning}}
+	store.Update(updatedPod)
+
+	if err := p.dispatch(queuedEvent{key: key}); err != nil {
+		t.Fatalf("dispatch() error = %v", err)
+	}
+	if len(h.created) != 1 || len(h.updated) != 1 {
+		t.Fatalf("after second dispatch: created=%d updated=%d, want 1 and 1", len(h.created), len(h.updated))
+	}
+	if h.updated[0][0] != pod {
+		t.Errorf("ObjectUpdated old = %v, want the original pod", h.updated[0][0])
+	}
+	if h.updated[0][1] != updatedPod {
+		t.Errorf("ObjectUpdated cur = %v, want the updated pod", h.updated[0][1])
+	}
+}
+
+func TestDispatchDelete(t *testing.T) {
+	pod := &api.Pod{ObjectMeta: api.ObjectMeta{Name: "foo", Namespace: "default"}}
+	key, err := cache.MetaNamespaceKeyFunc(pod)
+	if err != nil {
+		t.Fatalf("MetaNamespaceKeyFunc() error = %v", err)
+	}
+
+	tombstones := &sync.Map{}
+	tombstones.Store(key, pod)
+
+	h := &fakeHandler{}
+	p := &eventProcessor{store: cache.NewStore(cache.MetaNamespaceKeyFunc), tombstones: tombstones, eventHandler: h}
+	p.lastNotified.Store(key, pod)
+
+	if err := p.dispatch(queuedEvent{key: key}); err != nil {
+		t.Fatalf("dispatch() error = %v", err)
+	}
+	if len(h.deleted) != 1 {
+		t.Fatalf("ObjectDeleted called %d times, want 1", len(h.deleted))
+	}
+	if _, ok := p.lastNotified.Load(key); ok {
+		t.Error("lastNotified still has an entry after a successful delete")
+	}
+	if _, ok := tombstones.Load(key); ok {
+		t.Error("tombstones still has an entry after a successful delete")
+	}
+}
+
+func TestDispatchPropagatesHandlerError(t *testing.T) {
+	store := cache.NewStore(cache.MetaNamespaceKeyFunc)
+	pod := &api.Pod{ObjectMeta: api.ObjectMeta{Name: "foo", Namespace: "default"}}
+	store.Add(pod)
+	key, _ := cache.MetaNamespaceKeyFunc(pod)
+
+	wantErr := errors.New("notifier unavailable")
+	h := &fakeHandler{createErr: wantErr}
+	p := &eventProcessor{store: store, tombstones: &sync.Map{}, eventHandler: h}
+
+	if err := p.dispatch(queuedEvent{key: key}); err != wantErr {
+		t.Errorf("dispatch() error = %v, want %v", err, wantErr)
+	}
+	if _, ok := p.lastNotified.Load(key); ok {
+		t.Error("lastNotified has an entry after a failed create, want none")
+	}
+}
+
+func TestHandleErrDropsAfterMaxRetries(t *testing.T) {
+	queue := workqueue.NewRateLimitingQueue(workqueue.DefaultControllerRateLimiter())
+	defer queue.ShutDown()
+
+	tombstones := &sync.Map{}
+	tombstones.Store("default/foo", &api.Pod{})
+	p := &eventProcessor{tombstones: tombstones}
+
+	item := queuedEvent{key: "default/foo"}
+	failure := errors.New("boom")
+
+	for i := 0; i < maxRetries; i++ {
+		queue.Add(item)
+		got, _ := queue.Get()
+		p.handleErr(queue, got, failure)
+		queue.Done(got)
+	}
+	if _, ok := tombstones.Load("default/foo"); !ok {
+		t.Fatal("tombstones entry removed before maxRetries was reached")
+	}
+
+	queue.Add(item)
+	got, _ := queue.Get()
+	p.handleErr(queue, got, failure)
+	queue.Done(got)
+
+	if _, ok := tombstones.Load("default/foo"); ok {
+		t.Error("tombstones entry not cleaned up after the event was dropped past maxRetries")
+	}
+}
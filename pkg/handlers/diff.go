@@ -0,0 +1,115 @@
+/*
+Copyright 2016 Skippbox, Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/client-go/pkg/api"
+	batchv1 "k8s.io/client-go/pkg/apis/batch/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+// Diff summarizes what changed between old and cur, the two arguments an
+// ObjectUpdated implementation receives. It understands pods, deployments,
+// replication controllers, jobs and persistent volumes, and falls back to a
+// generic "updated" message for anything else (services included), so notifier backends can render "what changed" instead
+// of a bare "something updated".
+func Diff(old, cur interface{}) string {
+	switch curObj := cur.(type) {
+	case *api.Pod:
+		oldObj, ok := old.(*api.Pod)
+		if !ok {
+			break
+		}
+		return diffPod(oldObj, curObj)
+	case *v1beta1.Deployment:
+		oldObj, ok := old.(*v1beta1.Deployment)
+		if !ok {
+			break
+		}
+		return diffReplicas(oldObj.Spec.Replicas, curObj.Spec.Replicas)
+	case *api.ReplicationController:
+		oldObj, ok := old.(*api.ReplicationController)
+		if !ok {
+			break
+		}
+		return diffReplicas(oldObj.Spec.Replicas, curObj.Spec.Replicas)
+	case *batchv1.Job:
+		oldObj, ok := old.(*batchv1.Job)
+		if !ok {
+			break
+		}
+		return diffJob(oldObj, curObj)
+	case *api.PersistentVolume:
+		oldObj, ok := old.(*api.PersistentVolume)
+		if !ok {
+			break
+		}
+		if oldObj.Status.Phase != curObj.Status.Phase {
+			return fmt.Sprintf("phase changed from %s to %s", oldObj.Status.Phase, curObj.Status.Phase)
+		}
+	}
+
+	return "updated"
+}
+
+func diffPod(old, cur *api.Pod) string {
+	var changes []string
+
+	if old.Status.Phase != cur.Status.Phase {
+		changes = append(changes, fmt.Sprintf("status changed from %s to %s", old.Status.Phase, cur.Status.Phase))
+	}
+
+	images := make(map[string]string, len(old.Spec.Containers))
+	for _, c := range old.Spec.Containers {
+		images[c.Name] = c.Image
+	}
+	for _, c := range cur.Spec.Containers {
+		if oldImage, ok := images[c.Name]; ok && oldImage != c.Image {
+			changes = append(changes, fmt.Sprintf("container %s image changed from %s to %s", c.Name, oldImage, c.Image))
+		}
+	}
+
+	if len(changes) == 0 {
+		return "updated"
+	}
+	return strings.Join(changes, "; ")
+}
+
+func diffJob(old, cur *batchv1.Job) string {
+	if old.Status.Succeeded != cur.Status.Succeeded || old.Status.Failed != cur.Status.Failed {
+		return fmt.Sprintf("succeeded %d->%d, failed %d->%d", old.Status.Succeeded, cur.Status.Succeeded, old.Status.Failed, cur.Status.Failed)
+	}
+	return "updated"
+}
+
+func diffReplicas(old, cur *int32) string {
+	oldReplicas, curReplicas := int32(0), int32(0)
+	if old != nil {
+		oldReplicas = *old
+	}
+	if cur != nil {
+		curReplicas = *cur
+	}
+
+	if oldReplicas == curReplicas {
+		return "updated"
+	}
+	return fmt.Sprintf("replica count changed from %d to %d", oldReplicas, curReplicas)
+}
@@ -0,0 +1,82 @@
+/*
+Copyright 2016 Skippbox, Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import (
+	"testing"
+
+	"k8s.io/client-go/pkg/api"
+	batchv1 "k8s.io/client-go/pkg/apis/batch/v1"
+	"k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+func TestDiffPod(t *testing.T) {
+	old := &api.Pod{
+		Status: api.PodStatus{Phase: api.PodPending},
+		Spec: api.PodSpec{
+			Containers: []api.Container{{Name: "app", Image: "app:1"}},
+		},
+	}
+	cur := &api.Pod{
+		Status: api.PodStatus{Phase: api.PodRunning},
+		Spec: api.PodSpec{
+			Containers: []api.Container{{Name: "app", Image: "app:2"}},
+		},
+	}
+
+	got := Diff(old, cur)
+	want := "status changed from Pending to Running; container app image changed from app:1 to app:2"
+	if got != want {
+		t.Errorf("Diff() = %q, want %q", got, want)
+	}
+}
+
+func TestDiffPodNoChange(t *testing.T) {
+	pod := &api.Pod{Status: api.PodStatus{Phase: api.PodRunning}}
+	if got := Diff(pod, pod); got != "updated" {
+		t.Errorf("Diff() with no changes = %q, want %q", got, "updated")
+	}
+}
+
+func TestDiffDeploymentReplicas(t *testing.T) {
+	oldReplicas, curReplicas := int32(1), int32(3)
+	old := &v1beta1.Deployment{Spec: v1beta1.DeploymentSpec{Replicas: &oldReplicas}}
+	cur := &v1beta1.Deployment{Spec: v1beta1.DeploymentSpec{Replicas: &curReplicas}}
+
+	got := Diff(old, cur)
+	want := "replica count changed from 1 to 3"
+	if got != want {
+		t.Errorf("Diff() = %q, want %q", got, want)
+	}
+}
+
+func TestDiffJob(t *testing.T) {
+	old := &batchv1.Job{Status: batchv1.JobStatus{Succeeded: 0, Failed: 0}}
+	cur := &batchv1.Job{Status: batchv1.JobStatus{Succeeded: 1, Failed: 0}}
+
+	got := Diff(old, cur)
+	want := "succeeded 0->1, failed 0->0"
+	if got != want {
+		t.Errorf("Diff() = %q, want %q", got, want)
+	}
+}
+
+func TestDiffUnknownType(t *testing.T) {
+	if got := Diff("old", "cur"); got != "updated" {
+		t.Errorf("Diff() with an unrecognized type = %q, want %q", got, "updated")
+	}
+}
@@ -0,0 +1,33 @@
+/*
+Copyright 2016 Skippbox, Ltd.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package handlers
+
+import "k8s.io/client-go/tools/record"
+
+// Handler is implemented by every notifier backend (Slack, PagerDuty, ...)
+// that kubewatch dispatches resource events to. ObjectCreated/Deleted/Updated
+// return an error so the caller's workqueue can retry a failed delivery
+// (a Slack 500, a timeout, ...) with backoff instead of silently dropping it.
+type Handler interface {
+	// SetEventRecorder gives the handler an EventRecorder it can use to
+	// record Events against the object it just tried to forward, so
+	// delivery shows up on `kubectl describe`.
+	SetEventRecorder(recorder record.EventRecorder)
+	ObjectCreated(obj interface{}) error
+	ObjectDeleted(obj interface{}) error
+	ObjectUpdated(oldObj, newObj interface{}) error
+}